@@ -0,0 +1,41 @@
+package cmdpipe
+
+import (
+	"context"
+	"os"
+
+	"github.com/washtubs/cmdpipe/messaging"
+	grpctransport "github.com/washtubs/cmdpipe/transport/grpc"
+)
+
+// defaultGrpcAddr is used when CMDPIPE_GRPC_ADDR is unset.
+const defaultGrpcAddr = "localhost:7779"
+
+// grpcTransport is a Transport backed by a gRPC bidirectional streaming
+// RPC, removing the hard dependency on Redis and allowing cmdpipe to run
+// point-to-point over TCP/TLS.
+type grpcTransport struct {
+	addr string
+}
+
+func newGrpcTransport() *grpcTransport {
+	addr := os.Getenv("CMDPIPE_GRPC_ADDR")
+	if addr == "" {
+		addr = defaultGrpcAddr
+	}
+	return &grpcTransport{addr: addr}
+}
+
+func (t *grpcTransport) Dispatch(ctx context.Context, command *messaging.CommandRequest) (messaging.EnvelopeConn, error) {
+	return grpctransport.Dial(ctx, t.addr, command)
+}
+
+func (t *grpcTransport) Serve(ctx context.Context, commandName string, handler Handler) error {
+	return grpctransport.Serve(ctx, t.addr, func(conn messaging.EnvelopeConn, command *messaging.CommandRequest) {
+		if command.Name != commandName {
+			conn.Close()
+			return
+		}
+		handler(ctx, conn, command)
+	})
+}
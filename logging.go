@@ -0,0 +1,42 @@
+package cmdpipe
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+var (
+	loggerMu sync.RWMutex
+	logger   = newDefaultLogger()
+)
+
+// SetLogger overrides the structured logger cmdpipe uses for every
+// subsequent Send/Receive invocation. Embedders who can't have
+// interleaved unstructured stderr should call this before Send/Receive.
+func SetLogger(l *slog.Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+func getLogger() *slog.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// newDefaultLogger builds a JSON logger to stderr, honoring
+// CMDPIPE_LOG_LEVEL ("debug", "info", "warn", or "error"; default "info").
+func newDefaultLogger() *slog.Logger {
+	level := slog.LevelInfo
+	switch os.Getenv("CMDPIPE_LOG_LEVEL") {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
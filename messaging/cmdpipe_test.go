@@ -0,0 +1,36 @@
+package messaging
+
+import (
+	"testing"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// TestEnvelopeOneofRoundTrip guards against the oneof wrapper registration
+// being dropped again: without XXX_OneofWrappers, Marshal panics for any
+// Envelope with a non-nil Payload.
+func TestEnvelopeOneofRoundTrip(t *testing.T) {
+	cases := []*Envelope{
+		{Payload: &Envelope_Stdio{Stdio: &StdioFrame{Channel: Channel_STDOUT, Data: []byte("hello"), Eof: true}}},
+		{Payload: &Envelope_Exit{Exit: &ExitStatus{Code: 1, Signaled: true, Signal: 9}}},
+		{Payload: &Envelope_Signal{Signal: &Signal{Number: 2}}},
+		{Payload: &Envelope_Winsize{Winsize: &Winsize{Rows: 24, Cols: 80}}},
+		{Payload: &Envelope_Command{Command: &CommandRequest{Name: "echo", Params: []string{"hi"}}}},
+	}
+
+	for _, want := range cases {
+		b, err := proto.Marshal(want)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %s", want, err)
+		}
+
+		var got Envelope
+		if err := proto.Unmarshal(b, &got); err != nil {
+			t.Fatalf("Unmarshal: %s", err)
+		}
+
+		if got.GetPayload() == nil {
+			t.Fatalf("round-tripped envelope has no payload: %v", got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package messaging
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// maxFrameSize guards against a corrupt or malicious length prefix driving
+// an unbounded allocation.
+const maxFrameSize = 32 * 1024 * 1024
+
+// EnvelopeConn is anything that can read and write Envelopes, regardless
+// of how it frames them on the wire. *FramedConn implements it over a
+// net.Conn with uvarint-length-prefixed frames; transports whose
+// underlying stream already frames messages (e.g. gRPC) implement it
+// directly over that stream instead.
+type EnvelopeConn interface {
+	ReadEnvelope() (*Envelope, error)
+	WriteEnvelope(*Envelope) error
+	Close() error
+}
+
+// FramedConn wraps a net.Conn and reads/writes Envelopes as uvarint
+// length-prefixed protobuf payloads, one Envelope per frame.
+type FramedConn struct {
+	net.Conn
+
+	// writeMu serializes WriteEnvelope calls. pipe.go writes to a shared
+	// EnvelopeConn from multiple goroutines (stdout/stderr pumps, signal
+	// forwarding); without this, two frames' length prefixes and payloads
+	// can interleave and corrupt the stream.
+	writeMu sync.Mutex
+}
+
+// NewFramedConn wraps conn for Envelope-framed reads and writes.
+func NewFramedConn(conn net.Conn) *FramedConn {
+	return &FramedConn{Conn: conn}
+}
+
+// WriteEnvelope marshals env and writes it as a single length-prefixed
+// frame.
+func (f *FramedConn) WriteEnvelope(env *Envelope) error {
+	payload, err := proto.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshalling envelope: %s", err.Error())
+	}
+
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lenBuf, uint64(len(payload)))
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if _, err := f.Conn.Write(lenBuf[:n]); err != nil {
+		return fmt.Errorf("writing frame length: %s", err.Error())
+	}
+	if _, err := f.Conn.Write(payload); err != nil {
+		return fmt.Errorf("writing frame payload: %s", err.Error())
+	}
+	return nil
+}
+
+// ReadEnvelope blocks for the next length-prefixed frame and unmarshals it
+// into an Envelope.
+func (f *FramedConn) ReadEnvelope() (*Envelope, error) {
+	length, err := binary.ReadUvarint(byteReader{f.Conn})
+	if err != nil {
+		return nil, err
+	}
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("frame length %d exceeds max %d", length, maxFrameSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(f.Conn, payload); err != nil {
+		return nil, fmt.Errorf("reading frame payload: %s", err.Error())
+	}
+
+	var env Envelope
+	if err := proto.Unmarshal(payload, &env); err != nil {
+		return nil, fmt.Errorf("unmarshalling envelope: %s", err.Error())
+	}
+	return &env, nil
+}
+
+// byteReader adapts an io.Reader to the io.ByteReader that
+// binary.ReadUvarint requires, one byte at a time.
+type byteReader struct {
+	io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(b.Reader, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
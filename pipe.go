@@ -1,123 +1,290 @@
 package cmdpipe
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"io"
-	"io/ioutil"
 	"log"
-	"net"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
-	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/andrew-d/go-termutil"
-
-	rmq "gopkg.in/adjust/rmq.v1"
+	"github.com/creack/pty"
+	"github.com/washtubs/cmdpipe/messaging"
+	"github.com/washtubs/cmdpipe/policy"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
 )
 
 const (
 	service = "cmdpipe"
-)
 
-type Command struct {
-	Name   string   `json:"name"`
-	Params []string `json:"params"`
-	Env    []string `json:"env"`
-	Out    string   `json:"out"`
-	In     string   `json:"in"`
-	Error  string   `json:"error"`
-	Exit   string   `json:"exit"`
-}
+	// readBufSize is the chunk size used when pumping stdio into frames.
+	readBufSize = 32 * 1024
+
+	// terminationGrace is how long Handle waits after SIGTERM before
+	// escalating to SIGKILL on cancellation or client disconnect.
+	terminationGrace = 5 * time.Second
+)
 
+// CommandConsumer execs AllowedName for each command handed to it by a
+// Transport and pumps its stdio/exit/signal traffic over the connection
+// the transport established. If Policy is set, commands are additionally
+// checked against it before exec'ing.
 type CommandConsumer struct {
 	AllowedName string
+	Policy      *policy.Policy
 }
 
-func dialAll(command Command) (outConn, inConn, errConn, exitConn net.Conn) {
-	outConn, err := net.Dial("unix", inTemp(command.Out))
-	if err != nil {
-		log.Printf("Error dialing output %s: %s", command.Out, err.Error())
+// Handle is a Handler: it is registered with a Transport's Serve and is
+// invoked once per incoming command. If ctx is canceled, or conn is lost
+// before the command exits, the running child is sent SIGTERM and then,
+// after terminationGrace, SIGKILL.
+func (c *CommandConsumer) Handle(ctx context.Context, conn messaging.EnvelopeConn, command *messaging.CommandRequest) {
+	defer conn.Close()
+
+	l := requestLogger(command)
+	l.Info("got command", "name", command.Name)
+	if command.Name != c.AllowedName {
+		l.Warn("rejecting command", "name", command.Name, "reason", "not allowed")
 		return
 	}
 
-	inConn, err = net.Dial("unix", inTemp(command.In))
-	if err != nil {
-		log.Printf("Error dialing input %s: %s", command.In, err.Error())
-		return
+	if c.Policy != nil {
+		if err := c.Policy.Check(command); err != nil {
+			l.Warn("rejecting command", "name", command.Name, "reason", err.Error())
+			return
+		}
+		command.Env = c.Policy.FilterEnv(command.Name, command.Env)
 	}
 
-	errConn, err = net.Dial("unix", inTemp(command.Error))
-	if err != nil {
-		log.Printf("Error dialing error %s: %s", command.Error, err.Error())
-		return
+	cmd := exec.Command(c.AllowedName, command.Params...)
+	cmd.Env = append(os.Environ(), command.Env...)
+	if c.Policy != nil {
+		if cred := c.Policy.Credential(command.Name); cred != nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+		}
 	}
 
-	exitConn, err = net.Dial("unix", inTemp(command.Exit))
+	var ptmx *os.File
+	var stdin io.WriteCloser
+	var stdinCounter *countingWriteCloser
+	var ptyCopyDone chan struct{}
+	var err error
+	stdout := &countingWriter{w: &frameWriter{conn: conn, channel: messaging.Channel_STDOUT}}
+	stderr := &countingWriter{w: &frameWriter{conn: conn, channel: messaging.Channel_STDERR}}
+	if command.Tty {
+		ptmx, err = pty.StartWithSize(cmd, toPtySize(command.Winsize))
+		if err != nil {
+			l.Error("error starting command under pty", "error", err.Error())
+			return
+		}
+		defer ptmx.Close()
+		stdinCounter = newCountingWriteCloser(ptmx)
+		stdin = stdinCounter
+		ptyCopyDone = make(chan struct{})
+		go func() {
+			io.Copy(stdout, ptmx)
+			close(ptyCopyDone)
+		}()
+	} else {
+		stdinReader, stdinWriter := io.Pipe()
+		stdinCounter = newCountingWriteCloser(stdinWriter)
+		stdin = stdinCounter
+		cmd.Stdin = stdinReader
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		if err := cmd.Start(); err != nil {
+			l.Error("error starting command", "error", err.Error())
+			return
+		}
+	}
+
+	inboundDone := make(chan error, 1)
+	go func() { inboundDone <- pumpInbound(l, conn, cmd, stdin, ptmx) }()
+
+	waitDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			escalate(l, cmd, waitDone)
+		case err := <-inboundDone:
+			if err != nil {
+				escalate(l, cmd, waitDone)
+			}
+		case <-waitDone:
+		}
+	}()
+
+	l.Info("command started", "pid", cmd.Process.Pid)
+	status, err := waitManaged(cmd)
+	close(waitDone)
+	if ptyCopyDone != nil {
+		// The pty master only reports EOF once the child (and anything
+		// that inherited its slave fd) has exited and closed it, so this
+		// won't block past that - but it must run before we close conn/
+		// ptmx below, or trailing output the child wrote right before
+		// exiting can be dropped.
+		<-ptyCopyDone
+	}
+	exitStatus := &messaging.ExitStatus{Code: -1}
 	if err != nil {
-		log.Printf("Error dialing exit %s: %s", command.Exit, err.Error())
-		return
+		l.Warn("non exit-error running command", "error", err.Error())
+	} else if status.Signaled() {
+		exitStatus.Signaled = true
+		exitStatus.Signal = int32(status.Signal())
+	} else {
+		exitStatus.Code = int32(status.ExitStatus())
 	}
 
-	return
+	l.Info("command completed", "code", exitStatus.Code, "signaled", exitStatus.Signaled, "signal", exitStatus.Signal,
+		"stdout_bytes", stdout.n, "stderr_bytes", stderr.n, "stdin_bytes", stdinCounter.n)
+	conn.WriteEnvelope(&messaging.Envelope{
+		Payload: &messaging.Envelope_Exit{Exit: exitStatus},
+	})
 }
 
-func (c *CommandConsumer) Consume(delivery rmq.Delivery) {
-	var command Command
-	fmt.Println(delivery.Payload())
-	err := json.Unmarshal([]byte(delivery.Payload()), &command)
-	if err != nil {
-		log.Printf("Error %s", err.Error())
-		log.Printf("Problem unmarshalling payload %s", delivery.Payload())
-		return
-	}
+// pumpInbound reads Envelopes off conn until a connection error. STDIN
+// frames are written to stdin (the pty if ptmx is non-nil, otherwise the
+// write end of cmd.Stdin's pipe), and an EOF stdin frame closes that pipe;
+// Signal envelopes are delivered to the running process; Winsize
+// envelopes resize the pty. Reading goes on past end-of-stdin, so signals
+// still arrive and a later disconnect is still seen; it returns the error
+// that ended the connection, or the error from writing to stdin.
+func pumpInbound(l *slog.Logger, conn messaging.EnvelopeConn, cmd *exec.Cmd, stdin io.WriteCloser, ptmx *os.File) error {
+	for {
+		env, err := conn.ReadEnvelope()
+		if err != nil {
+			return err
+		}
 
-	outConn, inConn, errConn, exitConn := dialAll(command)
-	defer outConn.Close()
-	defer inConn.Close()
-	defer errConn.Close()
-	defer exitConn.Close()
+		if frame := env.GetStdio(); frame != nil {
+			if frame.Channel != messaging.Channel_STDIN {
+				continue
+			}
+			if len(frame.Data) > 0 && stdin != nil {
+				if _, err := stdin.Write(frame.Data); err != nil {
+					return err
+				}
+			}
+			if frame.Eof {
+				if ptmx == nil && stdin != nil {
+					stdin.Close()
+				}
+			}
+			continue
+		}
 
-	fmt.Printf("Got command [%s]\n", command.Name)
-	if command.Name != c.AllowedName {
-		log.Printf("Rejecting [%s]\n", command.Name)
-		delivery.Reject()
+		if sig := env.GetSignal(); sig != nil {
+			if cmd.Process != nil {
+				if err := cmd.Process.Signal(syscall.Signal(sig.Number)); err != nil {
+					l.Warn("error forwarding signal", "signal", sig.Number, "error", err.Error())
+				}
+			}
+			continue
+		}
+
+		if ws := env.GetWinsize(); ws != nil {
+			if ptmx != nil {
+				pty.Setsize(ptmx, toPtySize(ws))
+			} else if cmd.Process != nil {
+				cmd.Process.Signal(syscall.SIGWINCH)
+			}
+			continue
+		}
+	}
+}
+
+// escalate sends SIGTERM to cmd's process and, if it hasn't exited within
+// terminationGrace of done closing, follows up with SIGKILL.
+func escalate(l *slog.Logger, cmd *exec.Cmd, done <-chan struct{}) {
+	if cmd.Process == nil {
 		return
 	}
+	l.Warn("terminating command", "pid", cmd.Process.Pid)
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(terminationGrace):
+		l.Warn("killing command after grace period", "pid", cmd.Process.Pid)
+		cmd.Process.Signal(syscall.SIGKILL)
+	}
+}
 
-	fmt.Printf("Dialed: %s %s %s %s\n", command.Out, command.In, command.Error, command.Exit)
+// toPtySize converts a messaging.Winsize, defaulting to 80x24 when absent,
+// into the size pty.StartWithSize/pty.Setsize expect.
+func toPtySize(ws *messaging.Winsize) *pty.Winsize {
+	rows, cols := ws.GetRows(), ws.GetCols()
+	if rows == 0 {
+		rows = 24
+	}
+	if cols == 0 {
+		cols = 80
+	}
+	return &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}
+}
 
-	cmd := exec.Command(c.AllowedName, command.Params...)
-	cmd.Env = append(os.Environ(), command.Env...)
-	cmd.Stdout = outConn
-	cmd.Stdin = inConn
-	cmd.Stderr = errConn
+// frameWriter adapts a Channel on an EnvelopeConn to an io.Writer so it
+// can be assigned directly to cmd.Stdout/cmd.Stderr.
+type frameWriter struct {
+	conn    messaging.EnvelopeConn
+	channel messaging.Channel
+}
 
-	fmt.Printf("Command started\n")
-	err = cmd.Run()
-	exitCode := -1
+func (w *frameWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	err := w.conn.WriteEnvelope(&messaging.Envelope{
+		Payload: &messaging.Envelope_Stdio{
+			Stdio: &messaging.StdioFrame{Channel: w.channel, Data: data},
+		},
+	})
 	if err != nil {
-		exitErr, isExitErr := err.(*exec.ExitError)
-		if !isExitErr {
-			log.Printf("Non exit-error running command: %s\n", err.Error())
-		} else {
-			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-				exitCode = status.ExitStatus()
-			}
-		}
-	} else {
-		exitCode = 0
+		return 0, err
 	}
-	log.Println("Writing to exitConn <- " + strconv.Itoa(exitCode))
-	io.WriteString(exitConn, strconv.Itoa(exitCode))
+	return len(p), nil
+}
+
+// countingWriter wraps an io.Writer to tally the bytes written through it,
+// so Handle can log how much stdout/stderr a command produced.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countingWriteCloser is a countingWriter for the io.WriteCloser that
+// Handle writes inbound stdin frames to, so Handle can log how much
+// stdin a command was sent too.
+type countingWriteCloser struct {
+	countingWriter
+	c io.Closer
+}
 
-	fmt.Printf("Command completed\n")
+func newCountingWriteCloser(wc io.WriteCloser) *countingWriteCloser {
+	return &countingWriteCloser{countingWriter: countingWriter{w: wc}, c: wc}
+}
 
+func (w *countingWriteCloser) Close() error {
+	return w.c.Close()
+}
+
+// requestLogger returns a logger with the command's request_id attached,
+// so every log line for one invocation can be correlated on both the
+// Send and Receive sides.
+func requestLogger(command *messaging.CommandRequest) *slog.Logger {
+	return getLogger().With("request_id", command.GetRequestId(), "command", command.GetName())
 }
 
 func getTemp() string {
@@ -132,20 +299,46 @@ func getQueueName(commandName string) string {
 	return "command:" + commandName
 }
 
+// Receive runs until the process is killed; see ReceiveContext to shut
+// down cleanly instead.
 func Receive() {
+	ReceiveContext(context.Background())
+}
+
+// ReceiveContext runs the same command consumer as Receive, but returns
+// once ctx is canceled instead of running forever, giving in-flight
+// commands a chance to be sent SIGTERM/SIGKILL rather than orphaned.
+func ReceiveContext(ctx context.Context) {
 	if len(os.Args) <= 1 {
 		log.Printf("Need an argument to signify the allowed command")
 		return
 	}
 	commandName := os.Args[1]
 
-	conn := rmq.OpenConnection(service, "unix", path.Join(getTemp(), "redis.sock"), 1)
-	defer conn.Close()
-	queue := conn.OpenQueue(getQueueName(commandName))
-	queue.StartConsuming(10, 400*time.Millisecond)
+	globalReaper.start()
+	defer globalReaper.stop()
 
-	queue.AddConsumer("command consumer", &CommandConsumer{commandName})
-	select {}
+	consumer := &CommandConsumer{AllowedName: commandName, Policy: loadPolicy()}
+	if err := transportFor().Serve(ctx, commandName, consumer.Handle); err != nil && ctx.Err() == nil {
+		getLogger().Error("error serving", "error", err.Error())
+	}
+}
+
+// loadPolicy loads the ACL named by CMDPIPE_POLICY_FILE, if set. Without
+// it, Receive runs with no policy and falls back to the bare AllowedName
+// check.
+func loadPolicy() *policy.Policy {
+	path := os.Getenv("CMDPIPE_POLICY_FILE")
+	if path == "" {
+		getLogger().Warn("running without CMDPIPE_POLICY_FILE: every command name passed to Receive will run with its env forwarded unchecked")
+		return nil
+	}
+	p, err := policy.Load(path)
+	if err != nil {
+		getLogger().Error("error loading policy file", "path", path, "error", err.Error())
+		return nil
+	}
+	return p
 }
 
 func genCommandPipeSocket(pipeType string) string {
@@ -172,121 +365,145 @@ func Send() int {
 	}
 	commandName := os.Args[1]
 
-	conn := rmq.OpenConnection(service, "unix", path.Join(getTemp(), "redis.sock"), 1)
-	defer conn.Close()
-	queue := conn.OpenQueue(getQueueName(commandName))
+	params := []string{}
+	if len(os.Args) > 2 {
+		params = os.Args[2:]
+	}
 
-	outSock := genCommandPipeSocket("out")
-	defer os.Remove(inTemp(outSock))
-	outConn, err := net.Listen("unix", inTemp(outSock))
-	if err != nil {
-		panic(err.Error())
+	isTty := termutil.Isatty(os.Stdin.Fd()) && termutil.Isatty(os.Stdout.Fd())
+	var winsize *messaging.Winsize
+	if isTty {
+		winsize = readWinsize()
 	}
 
-	errSock := genCommandPipeSocket("err")
-	defer os.Remove(inTemp(errSock))
-	errConn, err := net.Listen("unix", inTemp(errSock))
-	if err != nil {
-		panic(err.Error())
+	command := &messaging.CommandRequest{
+		Name:      commandName,
+		Params:    params,
+		Env:       PropogateEnvironment(),
+		Tty:       isTty,
+		Winsize:   winsize,
+		RequestId: RandStringBytesMaskImprSrc(12),
 	}
+	l := requestLogger(command)
 
-	inSock := genCommandPipeSocket("in")
-	defer os.Remove(inTemp(inSock))
-	inConn, err := net.Listen("unix", inTemp(inSock))
-	if err != nil {
-		panic(err.Error())
+	if isTty {
+		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			l.Warn("error entering raw mode", "error", err.Error())
+		} else {
+			defer term.Restore(int(os.Stdin.Fd()), oldState)
+		}
 	}
 
-	exitSock := genCommandPipeSocket("exit")
-	defer os.Remove(inTemp(exitSock))
-	exitConn, err := net.Listen("unix", inTemp(exitSock))
+	conn, err := transportFor().Dispatch(context.Background(), command)
 	if err != nil {
-		panic(err.Error())
+		l.Error("error dispatching command", "error", err.Error())
+		return 1
 	}
+	defer conn.Close()
 
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func(outConn net.Listener) {
-		defer outConn.Close()
-		fd, err := outConn.Accept()
-		if err != nil {
-			log.Printf("err opening output socket: %s\n", err.Error())
-		}
-
-		io.Copy(os.Stdout, fd)
+	exit := make(chan int)
+	go pumpStdout(l, conn, exit)
+	go pumpLocalStdin(conn)
+	go forwardSignals(conn)
 
-		wg.Done()
-	}(outConn)
+	return <-exit
+}
 
-	go func(errConn net.Listener) {
-		defer errConn.Close()
-		fd, err := errConn.Accept()
+// pumpStdout reads Envelopes off conn and demultiplexes them onto the
+// local stdout/stderr, delivering the exit code on exit once an
+// ExitStatus envelope arrives. A signaled exit is translated to the
+// conventional 128+signum shell exit code.
+func pumpStdout(l *slog.Logger, conn messaging.EnvelopeConn, exit chan<- int) {
+	for {
+		env, err := conn.ReadEnvelope()
 		if err != nil {
-			log.Printf("err opening error socket: %s\n", err.Error())
+			l.Error("error reading conn", "error", err.Error())
+			exit <- -1
+			return
 		}
-
-		io.Copy(os.Stderr, fd)
-
-		wg.Done()
-	}(errConn)
-
-	go func(inConn net.Listener) {
-		defer inConn.Close()
-		fd, err := inConn.Accept()
-		if err != nil {
-			log.Printf("err opening input socket: %s\n", err.Error())
+		if frame := env.GetStdio(); frame != nil {
+			switch frame.Channel {
+			case messaging.Channel_STDOUT:
+				os.Stdout.Write(frame.Data)
+			case messaging.Channel_STDERR:
+				os.Stderr.Write(frame.Data)
+			}
+			continue
 		}
+		if status := env.GetExit(); status != nil {
+			if status.Signaled {
+				exit <- 128 + int(status.Signal)
+			} else {
+				exit <- int(status.Code)
+			}
+			return
+		}
+	}
+}
 
-		if !termutil.Isatty(os.Stdin.Fd()) {
-			io.Copy(fd, os.Stdin)
+// forwardSignals relays SIGINT/SIGTERM/SIGHUP to the running command and
+// SIGWINCH as a winsize update, for as long as conn stays open.
+func forwardSignals(conn messaging.EnvelopeConn) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH)
+	defer signal.Stop(sigCh)
+
+	for sig := range sigCh {
+		if sig == syscall.SIGWINCH {
+			sendWinsize(conn)
+			continue
 		}
-		fd.Close()
+		if s, ok := sig.(syscall.Signal); ok {
+			conn.WriteEnvelope(&messaging.Envelope{
+				Payload: &messaging.Envelope_Signal{Signal: &messaging.Signal{Number: int32(s)}},
+			})
+		}
+	}
+}
 
-		wg.Done()
-	}(inConn)
+func sendWinsize(conn messaging.EnvelopeConn) {
+	conn.WriteEnvelope(&messaging.Envelope{
+		Payload: &messaging.Envelope_Winsize{Winsize: readWinsize()},
+	})
+}
 
-	exit := make(chan int)
-	go func(exitConn net.Listener) {
-		defer exitConn.Close()
-		fd, err := exitConn.Accept()
-		if err != nil {
-			log.Printf("err opening exit socket: %s\n", err.Error())
-		}
+// readWinsize queries the current terminal size of stdin via TIOCGWINSZ.
+func readWinsize() *messaging.Winsize {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdin.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		getLogger().Warn("error reading winsize", "error", err.Error())
+		return nil
+	}
+	return &messaging.Winsize{Rows: uint32(ws.Row), Cols: uint32(ws.Col)}
+}
 
-		buf, err := ioutil.ReadAll(fd)
-		if err != nil {
-			log.Printf("err reading exit socket: %s\n", err.Error())
+// pumpLocalStdin reads the local process's stdin and forwards it as STDIN
+// frames on conn, ending with an eof frame. Raw-mode tty input and piped
+// input are both forwarded byte-for-byte without line buffering.
+func pumpLocalStdin(conn messaging.EnvelopeConn) {
+	buf := make([]byte, readBufSize)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			werr := conn.WriteEnvelope(&messaging.Envelope{
+				Payload: &messaging.Envelope_Stdio{
+					Stdio: &messaging.StdioFrame{Channel: messaging.Channel_STDIN, Data: data},
+				},
+			})
+			if werr != nil {
+				return
+			}
 		}
-
-		exitCode, err := strconv.Atoi(string(buf))
 		if err != nil {
-			log.Printf("Error converting exit code: %s: %s", string(buf), err.Error())
-			exitCode = -1
+			break
 		}
-
-		exit <- exitCode
-	}(exitConn)
-
-	params := []string{}
-	if len(os.Args) > 2 {
-		params = os.Args[2:]
 	}
-	bs, err := json.Marshal(Command{
-		Name:   commandName,
-		Params: params,
-		Env:    PropogateEnvironment(),
-		Out:    outSock,
-		In:     inSock,
-		Error:  errSock,
-		Exit:   exitSock,
+	conn.WriteEnvelope(&messaging.Envelope{
+		Payload: &messaging.Envelope_Stdio{
+			Stdio: &messaging.StdioFrame{Channel: messaging.Channel_STDIN, Eof: true},
+		},
 	})
-	if err != nil {
-		panic(err.Error())
-	}
-	queue.PublishBytes(bs)
-
-	wg.Wait()
-
-	return <-exit
 }
@@ -0,0 +1,75 @@
+package cmdpipe
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/washtubs/cmdpipe/messaging"
+)
+
+func TestCountingWriterTallies(t *testing.T) {
+	var buf bytes.Buffer
+	w := &countingWriter{w: &buf}
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if _, err := w.Write([]byte(" world")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	if w.n != int64(len("hello world")) {
+		t.Fatalf("got n=%d, want %d", w.n, len("hello world"))
+	}
+	if buf.String() != "hello world" {
+		t.Fatalf("got %q written through", buf.String())
+	}
+}
+
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *nopWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestCountingWriteCloserTalliesAndCloses(t *testing.T) {
+	inner := &nopWriteCloser{}
+	w := newCountingWriteCloser(inner)
+
+	if _, err := w.Write([]byte("stdin data")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if w.n != int64(len("stdin data")) {
+		t.Fatalf("got n=%d, want %d", w.n, len("stdin data"))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if !inner.closed {
+		t.Fatal("Close did not reach the wrapped WriteCloser")
+	}
+}
+
+func TestRequestLoggerAttachesRequestIDAndCommand(t *testing.T) {
+	var buf bytes.Buffer
+	orig := getLogger()
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer SetLogger(orig)
+
+	l := requestLogger(&messaging.CommandRequest{RequestId: "req-123", Name: "echo"})
+	l.Info("hello")
+
+	out := buf.String()
+	if !bytes.Contains([]byte(out), []byte(`"request_id":"req-123"`)) {
+		t.Fatalf("log line missing request_id: %s", out)
+	}
+	if !bytes.Contains([]byte(out), []byte(`"command":"echo"`)) {
+		t.Fatalf("log line missing command: %s", out)
+	}
+}
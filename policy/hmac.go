@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+const macSize = sha256.Size
+
+// Seal prepends an HMAC-SHA256 of payload, keyed by secret, so Open can
+// detect a payload that wasn't produced by someone holding secret -
+// guarding against anyone with queue access injecting arbitrary
+// commands. A nil/empty secret disables signing, so deployments that
+// haven't set CMDPIPE_SECRET keep working unsigned.
+func Seal(secret, payload []byte) []byte {
+	if len(secret) == 0 {
+		return payload
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return append(mac.Sum(nil), payload...)
+}
+
+// Open verifies and strips the HMAC added by Seal. A nil/empty secret
+// disables verification and returns sealed unchanged.
+func Open(secret, sealed []byte) ([]byte, error) {
+	if len(secret) == 0 {
+		return sealed, nil
+	}
+	if len(sealed) < macSize {
+		return nil, fmt.Errorf("payload too short to carry an HMAC")
+	}
+
+	gotMAC, payload := sealed[:macSize], sealed[macSize:]
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(gotMAC, mac.Sum(nil)) {
+		return nil, fmt.Errorf("HMAC verification failed")
+	}
+	return payload, nil
+}
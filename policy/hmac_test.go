@@ -0,0 +1,39 @@
+package policy
+
+import "testing"
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	secret := []byte("s3cr3t")
+	payload := []byte("command payload")
+
+	sealed := Seal(secret, payload)
+	got, err := Open(secret, sealed)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("got %q, want %q", got, payload)
+	}
+}
+
+func TestOpenRejectsWrongSecret(t *testing.T) {
+	sealed := Seal([]byte("s3cr3t"), []byte("command payload"))
+	if _, err := Open([]byte("wrong"), sealed); err == nil {
+		t.Fatal("expected verification failure with the wrong secret")
+	}
+}
+
+func TestSealOpenNoopWithoutSecret(t *testing.T) {
+	payload := []byte("command payload")
+	sealed := Seal(nil, payload)
+	if string(sealed) != string(payload) {
+		t.Fatalf("Seal with no secret should pass payload through unchanged, got %q", sealed)
+	}
+	got, err := Open(nil, sealed)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("got %q, want %q", got, payload)
+	}
+}
@@ -0,0 +1,129 @@
+// Package policy implements the ACL that CommandConsumer checks a
+// CommandRequest against before exec'ing it: which argument patterns are
+// permitted, which env vars are passed through, and which uid/gid the
+// child should run as.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/washtubs/cmdpipe/messaging"
+)
+
+// CommandPolicy is the ACL entry for a single allowed command name.
+type CommandPolicy struct {
+	ArgPatterns []string `json:"argPatterns"`
+	EnvAllow    []string `json:"envAllow"`
+	UID         *uint32  `json:"uid,omitempty"`
+	GID         *uint32  `json:"gid,omitempty"`
+
+	argRegexps []*regexp.Regexp
+}
+
+// Policy is the top-level ACL config: one CommandPolicy per allowed
+// command name. A command name absent from Commands is rejected.
+type Policy struct {
+	Commands map[string]CommandPolicy `json:"commands"`
+}
+
+// Load reads and compiles a Policy from a JSON file.
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file %s: %s", path, err.Error())
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy file %s: %s", path, err.Error())
+	}
+
+	for name, cp := range p.Commands {
+		for _, pattern := range cp.ArgPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("compiling arg pattern %q for %s: %s", pattern, name, err.Error())
+			}
+			cp.argRegexps = append(cp.argRegexps, re)
+		}
+		if (cp.UID == nil) != (cp.GID == nil) {
+			return nil, fmt.Errorf("%s: uid and gid must both be set or both be omitted - setting only one leaves the other at 0 (root)", name)
+		}
+		p.Commands[name] = cp
+	}
+
+	return &p, nil
+}
+
+// Check rejects a command whose name isn't configured or whose params
+// don't each match at least one of its argPatterns. A command with no
+// argPatterns accepts any params.
+func (p *Policy) Check(command *messaging.CommandRequest) error {
+	cp, ok := p.Commands[command.Name]
+	if !ok {
+		return fmt.Errorf("command %q is not in the policy", command.Name)
+	}
+
+	for _, param := range command.Params {
+		if !cp.matchesAny(param) {
+			return fmt.Errorf("param %q does not match any allowed pattern for %q", param, command.Name)
+		}
+	}
+
+	return nil
+}
+
+func (cp *CommandPolicy) matchesAny(param string) bool {
+	if len(cp.argRegexps) == 0 {
+		return true
+	}
+	for _, re := range cp.argRegexps {
+		if re.MatchString(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterEnv drops any env var not named in commandName's envAllow list.
+func (p *Policy) FilterEnv(commandName string, env []string) []string {
+	cp, ok := p.Commands[commandName]
+	if !ok {
+		return nil
+	}
+	allow := make(map[string]bool, len(cp.EnvAllow))
+	for _, k := range cp.EnvAllow {
+		allow[k] = true
+	}
+
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if allow[key] {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// Credential returns the uid/gid commandName's child process should run
+// as, or nil if the policy doesn't pin one for it.
+func (p *Policy) Credential(commandName string) *syscall.Credential {
+	cp, ok := p.Commands[commandName]
+	if !ok || (cp.UID == nil && cp.GID == nil) {
+		return nil
+	}
+	cred := &syscall.Credential{}
+	if cp.UID != nil {
+		cred.Uid = *cp.UID
+	}
+	if cp.GID != nil {
+		cred.Gid = *cp.GID
+	}
+	return cred
+}
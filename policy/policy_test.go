@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/washtubs/cmdpipe/messaging"
+)
+
+func writePolicy(t *testing.T, contents string) *Policy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing policy file: %s", err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	return p
+}
+
+func TestCheckRejectsUnknownCommand(t *testing.T) {
+	p := writePolicy(t, `{"commands":{"echo":{}}}`)
+	err := p.Check(&messaging.CommandRequest{Name: "rm"})
+	if err == nil {
+		t.Fatal("expected an error for a command not in the policy")
+	}
+}
+
+func TestCheckMatchesArgPatterns(t *testing.T) {
+	p := writePolicy(t, `{"commands":{"echo":{"argPatterns":["^hello$"]}}}`)
+
+	if err := p.Check(&messaging.CommandRequest{Name: "echo", Params: []string{"hello"}}); err != nil {
+		t.Fatalf("expected matching param to be allowed: %s", err)
+	}
+	if err := p.Check(&messaging.CommandRequest{Name: "echo", Params: []string{"goodbye"}}); err == nil {
+		t.Fatal("expected a non-matching param to be rejected")
+	}
+}
+
+func TestFilterEnvDropsUnlistedVars(t *testing.T) {
+	p := writePolicy(t, `{"commands":{"echo":{"envAllow":["PATH"]}}}`)
+
+	got := p.FilterEnv("echo", []string{"PATH=/usr/bin", "SECRET=xyz"})
+	if len(got) != 1 || got[0] != "PATH=/usr/bin" {
+		t.Fatalf("got %v, want only PATH to survive", got)
+	}
+}
+
+func TestFilterEnvUnknownCommand(t *testing.T) {
+	p := writePolicy(t, `{"commands":{"echo":{}}}`)
+	if got := p.FilterEnv("rm", []string{"PATH=/usr/bin"}); got != nil {
+		t.Fatalf("got %v, want nil for a command not in the policy", got)
+	}
+}
+
+func TestCredentialRequiresBothUidAndGid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"commands":{"echo":{"gid":1000}}}`), 0o600); err != nil {
+		t.Fatalf("writing policy file: %s", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected Load to reject a policy that sets gid without uid")
+	}
+}
+
+func TestCredential(t *testing.T) {
+	p := writePolicy(t, `{"commands":{"echo":{"uid":1000,"gid":1000},"ls":{}}}`)
+
+	cred := p.Credential("echo")
+	if cred == nil || cred.Uid != 1000 || cred.Gid != 1000 {
+		t.Fatalf("got %+v, want uid=1000 gid=1000", cred)
+	}
+	if cred := p.Credential("ls"); cred != nil {
+		t.Fatalf("got %+v, want nil for a command with no uid/gid pinned", cred)
+	}
+}
@@ -0,0 +1,36 @@
+package cmdpipe
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	letterBytes   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	letterIdxBits = 6
+	letterIdxMask = 1<<letterIdxBits - 1
+	letterIdxMax  = 63 / letterIdxBits
+)
+
+var randSrc = rand.NewSource(time.Now().UnixNano())
+
+// RandStringBytesMaskImprSrc returns a random alphanumeric string of
+// length n, used to name throwaway unix sockets and tag each invocation
+// with a request ID. It isn't cryptographically secure; it only needs to
+// make collisions within one process's socket namespace unlikely, not
+// make the string unguessable.
+func RandStringBytesMaskImprSrc(n int) string {
+	b := make([]byte, n)
+	for i, cache, remain := n-1, randSrc.Int63(), letterIdxMax; i >= 0; {
+		if remain == 0 {
+			cache, remain = randSrc.Int63(), letterIdxMax
+		}
+		if idx := int(cache & letterIdxMask); idx < len(letterBytes) {
+			b[i] = letterBytes[idx]
+			i--
+		}
+		cache >>= letterIdxBits
+		remain--
+	}
+	return string(b)
+}
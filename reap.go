@@ -0,0 +1,145 @@
+package cmdpipe
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reaper drains SIGCHLD-triggered wait4(-1, WNOHANG) sweeps for orphaned
+// grandchildren (e.g. children of a wrapper shell cmdpipe execs, left
+// behind once the shell itself exits), without racing the specific-pid
+// cmd.Wait call Handle makes for the command it started directly: a pid
+// registered via manage has its status handed back over a channel instead
+// of being silently reaped out from under that cmd.Wait.
+type reaper struct {
+	mu      sync.Mutex
+	managed map[int]chan syscall.WaitStatus
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+var globalReaper = &reaper{managed: make(map[int]chan syscall.WaitStatus)}
+
+// start installs the SIGCHLD handler, if it isn't already. ReceiveContext
+// calls this for the duration of its Serve loop, so that merely importing
+// this package - e.g. from the Send side, or an embedder linking it in as
+// a library - doesn't reap children it never started.
+func (r *reaper) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopCh != nil {
+		return
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	r.stopCh = stopCh
+	r.doneCh = doneCh
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGCHLD)
+	go func() {
+		defer close(doneCh)
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-sigCh:
+				r.sweep()
+			}
+		}
+	}()
+}
+
+// stop tears down the SIGCHLD handler started by start and waits for its
+// goroutine to exit.
+func (r *reaper) stop() {
+	r.mu.Lock()
+	stopCh, doneCh := r.stopCh, r.doneCh
+	r.stopCh, r.doneCh = nil, nil
+	r.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+// sweep drains every exited child it can reap without blocking. A pid
+// under manage has its status handed to the registered channel; anything
+// else is an orphaned grandchild with no other reaper, so it's dropped
+// once reaped.
+func (r *reaper) sweep() {
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		ch := r.managed[pid]
+		r.mu.Unlock()
+		if ch != nil {
+			ch <- status
+		}
+	}
+}
+
+// manage registers pid so that, if sweep collects its exit status before
+// waitManaged's own cmd.Wait does, the status is handed back instead of
+// lost to a racing wait4(-1). unmanage must be called once waitManaged
+// returns.
+func (r *reaper) manage(pid int) chan syscall.WaitStatus {
+	ch := make(chan syscall.WaitStatus, 1)
+	r.mu.Lock()
+	r.managed[pid] = ch
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *reaper) unmanage(pid int) {
+	r.mu.Lock()
+	delete(r.managed, pid)
+	r.mu.Unlock()
+}
+
+// waitManaged waits for cmd to exit, same as cmd.Wait, except it also
+// tolerates the global reaper's sweep reaping cmd's pid first: in that
+// case cmd.Wait itself would fail with ECHILD since the kernel already
+// gave the status to the other wait4 call, so waitManaged takes the
+// status off the channel the reaper handed it instead.
+func waitManaged(cmd *exec.Cmd) (syscall.WaitStatus, error) {
+	pid := cmd.Process.Pid
+	statusCh := globalReaper.manage(pid)
+	defer globalReaper.unmanage(pid)
+
+	type result struct {
+		status syscall.WaitStatus
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		err := cmd.Wait()
+		if err == nil {
+			done <- result{status: cmd.ProcessState.Sys().(syscall.WaitStatus)}
+			return
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			done <- result{status: exitErr.Sys().(syscall.WaitStatus)}
+			return
+		}
+		done <- result{err: err}
+	}()
+
+	select {
+	case status := <-statusCh:
+		return status, nil
+	case r := <-done:
+		return r.status, r.err
+	}
+}
@@ -0,0 +1,36 @@
+package cmdpipe
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestWaitManagedSurvivesCompetingSweep exercises the race the reaper is
+// meant to resolve: a sweep that reaps cmd's pid before cmd.Wait gets to
+// it must still hand the real exit status back to waitManaged, rather
+// than waitManaged seeing ECHILD.
+func TestWaitManagedSurvivesCompetingSweep(t *testing.T) {
+	globalReaper.start()
+	defer globalReaper.stop()
+
+	cmd := exec.Command("false")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting command: %s", err)
+	}
+
+	status, err := waitManaged(cmd)
+	if err != nil {
+		t.Fatalf("waitManaged: %s", err)
+	}
+	if status.ExitStatus() != 1 {
+		t.Fatalf("got exit status %d, want 1", status.ExitStatus())
+	}
+
+	// The managed entry must be cleaned up once waitManaged returns.
+	globalReaper.mu.Lock()
+	_, stillManaged := globalReaper.managed[cmd.Process.Pid]
+	globalReaper.mu.Unlock()
+	if stillManaged {
+		t.Fatal("pid still registered with the reaper after waitManaged returned")
+	}
+}
@@ -0,0 +1,109 @@
+package cmdpipe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/washtubs/cmdpipe/messaging"
+	"github.com/washtubs/cmdpipe/policy"
+
+	proto "github.com/golang/protobuf/proto"
+	rmq "gopkg.in/adjust/rmq.v1"
+)
+
+// secret returns the shared secret CMDPIPE_SECRET used to HMAC-sign
+// deliveries, protecting against anyone with Redis access injecting
+// arbitrary commands onto a command queue.
+func secret() []byte {
+	return []byte(os.Getenv("CMDPIPE_SECRET"))
+}
+
+// redisTransport is the original transport: commands are published onto a
+// per-command-name Redis queue, and the client listens on a throwaway
+// unix socket (named in CommandRequest.Conn) for the consumer to dial
+// back for the actual stdio/exit/signal traffic.
+type redisTransport struct{}
+
+func newRedisTransport() *redisTransport {
+	if len(secret()) == 0 {
+		getLogger().Warn("running without CMDPIPE_SECRET: anyone with Redis access can inject unsigned commands onto the queue")
+	}
+	return &redisTransport{}
+}
+
+func (t *redisTransport) Dispatch(ctx context.Context, command *messaging.CommandRequest) (messaging.EnvelopeConn, error) {
+	conn := rmq.OpenConnection(service, "unix", path.Join(getTemp(), "redis.sock"), 1)
+	defer conn.Close()
+	queue := conn.OpenQueue(getQueueName(command.Name))
+
+	sock := genCommandPipeSocket("conn")
+	defer os.Remove(inTemp(sock))
+	listener, err := net.Listen("unix", inTemp(sock))
+	if err != nil {
+		return nil, fmt.Errorf("listening for stdio conn: %s", err.Error())
+	}
+
+	command.Conn = sock
+	bs, err := proto.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling command: %s", err.Error())
+	}
+	queue.PublishBytes(policy.Seal(secret(), bs))
+
+	fd, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return nil, fmt.Errorf("accepting stdio conn: %s", err.Error())
+	}
+	return messaging.NewFramedConn(fd), nil
+}
+
+func (t *redisTransport) Serve(ctx context.Context, commandName string, handler Handler) error {
+	conn := rmq.OpenConnection(service, "unix", path.Join(getTemp(), "redis.sock"), 1)
+	defer conn.Close()
+	queue := conn.OpenQueue(getQueueName(commandName))
+	queue.StartConsuming(10, 400*time.Millisecond)
+	queue.AddConsumer("command consumer", &redisConsumer{ctx: ctx, handler: handler})
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// redisConsumer adapts an rmq.Delivery to the transport-agnostic Handler:
+// unmarshal the CommandRequest, dial back the stdio conn it names, and
+// hand both to handler.
+type redisConsumer struct {
+	ctx     context.Context
+	handler Handler
+}
+
+func (c *redisConsumer) Consume(delivery rmq.Delivery) {
+	payload, err := policy.Open(secret(), []byte(delivery.Payload()))
+	if err != nil {
+		getLogger().Warn("rejecting delivery with invalid signature", "error", err.Error())
+		delivery.Reject()
+		return
+	}
+
+	var command messaging.CommandRequest
+	if err := proto.Unmarshal(payload, &command); err != nil {
+		getLogger().Error("error unmarshalling payload", "error", err.Error())
+		delivery.Reject()
+		return
+	}
+
+	l := requestLogger(&command)
+	conn, err := net.Dial("unix", inTemp(command.Conn))
+	if err != nil {
+		l.Error("error dialing back", "conn", command.Conn, "error", err.Error())
+		delivery.Reject()
+		return
+	}
+	delivery.Ack()
+
+	c.handler(c.ctx, messaging.NewFramedConn(conn), &command)
+}
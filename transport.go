@@ -0,0 +1,41 @@
+package cmdpipe
+
+import (
+	"context"
+	"os"
+
+	"github.com/washtubs/cmdpipe/messaging"
+)
+
+// Handler processes one command delivery over its EnvelopeConn. It is
+// called with the connection already established and command already
+// authenticated against the transport, if the transport does that. ctx is
+// canceled when the Serve call that dispatched it is shutting down, and
+// Handler implementations should use it to tear down any running child.
+type Handler func(ctx context.Context, conn messaging.EnvelopeConn, command *messaging.CommandRequest)
+
+// Transport abstracts how a CommandRequest is dispatched to a consumer and
+// how the resulting stdio/exit/signal connection is established, so that
+// Send/Receive aren't hard-coded to the Redis-queue + unix-socket
+// mechanism.
+type Transport interface {
+	// Dispatch publishes command to a consumer and blocks until the
+	// consumer has connected back, returning the connection for its
+	// stdio/exit/signal frames.
+	Dispatch(ctx context.Context, command *messaging.CommandRequest) (messaging.EnvelopeConn, error)
+
+	// Serve runs until ctx is canceled, invoking handler for each command
+	// addressed to commandName.
+	Serve(ctx context.Context, commandName string, handler Handler) error
+}
+
+// transportFor selects a Transport implementation based on
+// CMDPIPE_TRANSPORT ("redis", the default, or "grpc").
+func transportFor() Transport {
+	switch os.Getenv("CMDPIPE_TRANSPORT") {
+	case "grpc":
+		return newGrpcTransport()
+	default:
+		return newRedisTransport()
+	}
+}
@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/washtubs/cmdpipe/messaging"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Dial opens a CmdPipe Exec stream to addr and sends command as the
+// stream's first Envelope, returning a connection for the rest of the
+// command's stdio/exit/signal traffic. It dials with TLS if any of
+// CMDPIPE_GRPC_CA_FILE, CMDPIPE_GRPC_CERT_FILE or CMDPIPE_GRPC_KEY_FILE is
+// set (the cert/key pair being for mutual TLS); if none is set it falls
+// back to a plaintext dial, with a warning, since this transport is meant
+// to run cross-host.
+func Dial(ctx context.Context, addr string, command *messaging.CommandRequest) (messaging.EnvelopeConn, error) {
+	creds, err := clientCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS: %s", err.Error())
+	}
+	if creds == nil {
+		slog.Warn("dialing without TLS; set CMDPIPE_GRPC_CA_FILE to enable it", "addr", addr)
+		creds = insecure.NewCredentials()
+	}
+
+	cc, err := grpclib.DialContext(ctx, addr, grpclib.WithTransportCredentials(creds), grpclib.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %s", addr, err.Error())
+	}
+
+	client := NewCmdPipeClient(cc)
+	stream, err := client.Exec(ctx)
+	if err != nil {
+		cc.Close()
+		return nil, fmt.Errorf("opening exec stream: %s", err.Error())
+	}
+
+	if err := stream.Send(&messaging.Envelope{
+		Payload: &messaging.Envelope_Command{Command: command},
+	}); err != nil {
+		cc.Close()
+		return nil, fmt.Errorf("sending command: %s", err.Error())
+	}
+
+	return newStreamConn(stream, cc.Close), nil
+}
@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/washtubs/cmdpipe/messaging"
+)
+
+// stream is satisfied by both CmdPipe_ExecClient and CmdPipe_ExecServer.
+type stream interface {
+	Send(*messaging.Envelope) error
+	Recv() (*messaging.Envelope, error)
+}
+
+// streamConn adapts a CmdPipe Exec stream to messaging.EnvelopeConn, so
+// the rest of cmdpipe can treat a gRPC stream the same as a framed unix
+// socket connection.
+type streamConn struct {
+	stream  stream
+	closeFn func() error
+
+	// sendMu serializes Send calls: grpc-go streams don't support
+	// concurrent sends from multiple goroutines, and pipe.go writes to a
+	// shared EnvelopeConn from more than one.
+	sendMu sync.Mutex
+}
+
+func newStreamConn(s stream, closeFn func() error) *streamConn {
+	return &streamConn{stream: s, closeFn: closeFn}
+}
+
+func (c *streamConn) ReadEnvelope() (*messaging.Envelope, error) {
+	return c.stream.Recv()
+}
+
+func (c *streamConn) WriteEnvelope(env *messaging.Envelope) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.stream.Send(env)
+}
+
+func (c *streamConn) Close() error {
+	if c.closeFn == nil {
+		return nil
+	}
+	return c.closeFn()
+}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLS is configured entirely through environment variables, matching how
+// the rest of cmdpipe's transport and policy config is threaded in
+// (CMDPIPE_GRPC_ADDR, CMDPIPE_SECRET, CMDPIPE_POLICY_FILE).
+const (
+	envCertFile = "CMDPIPE_GRPC_CERT_FILE"
+	envKeyFile  = "CMDPIPE_GRPC_KEY_FILE"
+	envCAFile   = "CMDPIPE_GRPC_CA_FILE"
+)
+
+// serverCredentials builds TLS transport credentials for Serve from
+// CMDPIPE_GRPC_CERT_FILE/CMDPIPE_GRPC_KEY_FILE, or reports that neither is
+// set so the caller can fall back to a plaintext listener.
+func serverCredentials() (credentials.TransportCredentials, error) {
+	certFile, keyFile := os.Getenv(envCertFile), os.Getenv(envKeyFile)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server cert/key: %s", err.Error())
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile := os.Getenv(envCAFile); caFile != "" {
+		pool, err := loadCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// clientCredentials builds TLS transport credentials for Dial from
+// CMDPIPE_GRPC_CA_FILE (and, for mutual TLS, CMDPIPE_GRPC_CERT_FILE/
+// CMDPIPE_GRPC_KEY_FILE), or reports that none of these are set so the
+// caller can fall back to an insecure dial.
+func clientCredentials() (credentials.TransportCredentials, error) {
+	caFile := os.Getenv(envCAFile)
+	certFile, keyFile := os.Getenv(envCertFile), os.Getenv(envKeyFile)
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if caFile != "" {
+		pool, err := loadCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client cert/key: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file %s: %s", caFile, err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
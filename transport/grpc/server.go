@@ -0,0 +1,68 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/washtubs/cmdpipe/messaging"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Handler processes one command over the stream it arrived on.
+type Handler func(conn messaging.EnvelopeConn, command *messaging.CommandRequest)
+
+// Serve listens on addr and runs a CmdPipe gRPC server until ctx is
+// canceled, invoking handler once per Exec stream. It serves over TLS if
+// CMDPIPE_GRPC_CERT_FILE/CMDPIPE_GRPC_KEY_FILE are set; otherwise it
+// falls back to a plaintext listener, with a warning, since this
+// transport is meant to run cross-host.
+func Serve(ctx context.Context, addr string, handler Handler) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	var opts []grpclib.ServerOption
+	creds, err := serverCredentials()
+	if err != nil {
+		return err
+	}
+	if creds == nil {
+		slog.Warn("serving without TLS; set CMDPIPE_GRPC_CERT_FILE/CMDPIPE_GRPC_KEY_FILE to enable it", "addr", addr)
+	} else {
+		opts = append(opts, grpclib.Creds(creds))
+	}
+
+	s := grpclib.NewServer(opts...)
+	RegisterCmdPipeServer(s, &server{handler: handler})
+
+	go func() {
+		<-ctx.Done()
+		s.GracefulStop()
+	}()
+
+	return s.Serve(lis)
+}
+
+type server struct {
+	UnimplementedCmdPipeServer
+	handler Handler
+}
+
+func (s *server) Exec(stream CmdPipe_ExecServer) error {
+	env, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	command := env.GetCommand()
+	if command == nil {
+		return status.Error(codes.InvalidArgument, "first envelope on an Exec stream must carry a CommandRequest")
+	}
+
+	s.handler(newStreamConn(stream, func() error { return nil }), command)
+	return nil
+}